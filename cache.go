@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+var scrapeThrottleInterval = flag.Duration("scrape-throttle-interval", time.Second,
+	"Minimum interval between live fetches per collector; repeat scrapes within the interval reuse the last result")
+
+// cachedFetch is a single memoized SlurmFetcher.Fetch result.
+type cachedFetch struct {
+	data []byte
+	err  error
+	at   time.Time
+}
+
+// AtomicThrottledCache memoizes a SlurmFetcher's result for a short
+// interval so that collectors sharing a scrape target (e.g. multiple
+// Prometheus scrapers, or a collector re-entered before the controller
+// has anything new to say) don't each shell out or hit slurmrestd
+// independently.
+type AtomicThrottledCache struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	current *cachedFetch
+}
+
+// NewAtomicThrottledCache returns a cache that throttles fetches to at
+// most one live call per --scrape-throttle-interval.
+func NewAtomicThrottledCache() *AtomicThrottledCache {
+	return &AtomicThrottledCache{interval: *scrapeThrottleInterval}
+}
+
+// Fetch returns the cached result if it is still within the throttle
+// interval, otherwise calls fetcher.Fetch(), caches the outcome
+// (including errors, so a flapping backend doesn't get hammered), and
+// returns it.
+func (c *AtomicThrottledCache) Fetch(fetcher SlurmFetcher) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != nil && time.Since(c.current.at) < c.interval {
+		return c.current.data, c.current.err
+	}
+	data, err := fetcher.Fetch()
+	c.current = &cachedFetch{data: data, err: err, at: time.Now()}
+	return data, err
+}
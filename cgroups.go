@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NucciTheBoss/prometheus-slurm-exporter/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/slog"
+)
+
+// NodeAgentSubcommand is the subcommand that puts the exporter binary into
+// per-node cgroup-scraping mode, e.g. `slurm-exporter node-agent`.
+const NodeAgentSubcommand = "node-agent"
+
+// IsNodeAgentMode reports whether argv requests node-agent mode.
+func IsNodeAgentMode(argv []string) bool {
+	return len(argv) > 1 && argv[1] == NodeAgentSubcommand
+}
+
+// defaultCgroupRoots are searched in order for the Slurm cgroup hierarchy,
+// covering both the cgroup v2 unified layout and the v1 fallback.
+var defaultCgroupRoots = []string{
+	"/sys/fs/cgroup/system.slice/slurmstepd.scope",
+	"/sys/fs/cgroup/cpu,cpuacct/slurm",
+	"/sys/fs/cgroup/slurm",
+}
+
+// jobStepDirPattern matches a Slurm job/step cgroup leaf directory, e.g.
+// ".../uid_1000/job_12345/step_0".
+var jobStepDirPattern = regexp.MustCompile(`uid_(\d+)/job_(\d+)/step_([^/]+)$`)
+
+type CgroupJobMetrics struct {
+	Uid                string
+	User               string
+	JobId              string
+	StepId             string
+	CpuSeconds         float64
+	MemoryCurrentBytes float64
+	MemoryMaxBytes     float64
+	Pids               float64
+	IoReadBytes        float64
+	IoWriteBytes       float64
+}
+
+// discoverJobStepDirs walks root looking for uid_*/job_*/step_* leaf
+// directories.
+func discoverJobStepDirs(root string) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && jobStepDirPattern.MatchString(path) {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// parseCgroupJobMetrics reads the cpu.stat, memory.current, memory.peak,
+// io.stat and pids.current files under a single job/step cgroup directory.
+func parseCgroupJobMetrics(path string) (*CgroupJobMetrics, error) {
+	m := jobStepDirPattern.FindStringSubmatch(path)
+	if m == nil {
+		return nil, fmt.Errorf("%s does not look like a slurm job/step cgroup", path)
+	}
+	metrics := &CgroupJobMetrics{Uid: m[1], JobId: m[2], StepId: m[3]}
+	if u, err := user.LookupId(metrics.Uid); err == nil {
+		metrics.User = u.Username
+	}
+
+	if usec, err := readCgroupKeyValue(filepath.Join(path, "cpu.stat"), "usage_usec"); err == nil {
+		metrics.CpuSeconds = usec / 1e6
+	}
+	if cur, err := readCgroupSingleValue(filepath.Join(path, "memory.current")); err == nil {
+		metrics.MemoryCurrentBytes = cur
+	}
+	if peak, err := readCgroupSingleValue(filepath.Join(path, "memory.peak")); err == nil {
+		metrics.MemoryMaxBytes = peak
+	}
+	if pids, err := readCgroupSingleValue(filepath.Join(path, "pids.current")); err == nil {
+		metrics.Pids = pids
+	}
+	if rbytes, wbytes, err := readCgroupIoStat(filepath.Join(path, "io.stat")); err == nil {
+		metrics.IoReadBytes = rbytes
+		metrics.IoWriteBytes = wbytes
+	}
+	return metrics, nil
+}
+
+func readCgroupSingleValue(path string) (float64, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(raw)), 64)
+}
+
+// readCgroupKeyValue reads a "key value\n..." file (e.g. cpu.stat) and
+// returns the value for key.
+func readCgroupKeyValue(path, key string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseFloat(fields[1], 64)
+		}
+	}
+	return 0, fmt.Errorf("%s: key %q not found", path, key)
+}
+
+// readCgroupIoStat sums rbytes/wbytes across every device line in io.stat.
+func readCgroupIoStat(path string) (readBytes, writeBytes float64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		for _, field := range strings.Fields(scanner.Text()) {
+			k, v, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, perr := strconv.ParseFloat(v, 64)
+			if perr != nil {
+				continue
+			}
+			switch k {
+			case "rbytes":
+				readBytes += n
+			case "wbytes":
+				writeBytes += n
+			}
+		}
+	}
+	return readBytes, writeBytes, nil
+}
+
+// fetchCgroupJobMetrics discovers every job/step cgroup under the first
+// root in defaultCgroupRoots that contains any, and parses its metrics.
+func fetchCgroupJobMetrics() ([]*CgroupJobMetrics, error) {
+	var jobs []*CgroupJobMetrics
+	for _, root := range defaultCgroupRoots {
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		dirs, err := discoverJobStepDirs(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			metrics, err := parseCgroupJobMetrics(dir)
+			if err != nil {
+				slog.Error("Failed to parse cgroup job metrics: " + err.Error())
+				continue
+			}
+			jobs = append(jobs, metrics)
+		}
+		if len(dirs) > 0 {
+			break
+		}
+	}
+	return jobs, nil
+}
+
+// CgroupsCollector exports per-job resource usage by reading Slurm's
+// cgroup hierarchy directly. It is intended to run on each compute node
+// in node-agent mode, alongside (not instead of) the cluster-wide
+// NodesCollector/JobsCollector rollups.
+type CgroupsCollector struct {
+	jobCpuSeconds    *prometheus.Desc
+	jobMemoryCurrent *prometheus.Desc
+	jobMemoryMax     *prometheus.Desc
+	jobPids          *prometheus.Desc
+	jobIoReadBytes   *prometheus.Desc
+	jobIoWriteBytes  *prometheus.Desc
+	scrape           *metrics.ScrapeMetrics
+}
+
+func NewCgroupsCollector() *CgroupsCollector {
+	job := metrics.NewFactory("job")
+	return &CgroupsCollector{
+		jobCpuSeconds:    job.NewDesc("cpu_seconds_total", "Cumulative cpu time consumed by this job step", "job_id", "step_id", "uid", "user"),
+		jobMemoryCurrent: job.NewDesc("memory_current_bytes", "Current memory usage of this job step", "job_id", "step_id", "uid", "user"),
+		jobMemoryMax:     job.NewDesc("memory_max_bytes", "Peak memory usage of this job step", "job_id", "step_id", "uid", "user"),
+		jobPids:          job.NewDesc("pids", "Number of pids in this job step", "job_id", "step_id", "uid", "user"),
+		jobIoReadBytes:   job.NewDesc("io_read_bytes_total", "Cumulative bytes read by this job step", "job_id", "step_id", "uid", "user"),
+		jobIoWriteBytes:  job.NewDesc("io_write_bytes_total", "Cumulative bytes written by this job step", "job_id", "step_id", "uid", "user"),
+		scrape:           metrics.NewScrapeMetrics("cgroup"),
+	}
+}
+
+func (cc *CgroupsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.jobCpuSeconds
+	ch <- cc.jobMemoryCurrent
+	ch <- cc.jobMemoryMax
+	ch <- cc.jobPids
+	ch <- cc.jobIoReadBytes
+	ch <- cc.jobIoWriteBytes
+	cc.scrape.Describe(ch)
+}
+
+func (cc *CgroupsCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	defer func() {
+		cc.scrape.ObserveDuration(start)
+		cc.scrape.Collect(ch)
+	}()
+	jobs, err := fetchCgroupJobMetrics()
+	if err != nil {
+		slog.Error("Failed to walk slurm cgroup hierarchy: " + err.Error())
+		cc.scrape.IncErrors()
+		return
+	}
+	for _, job := range jobs {
+		labels := []string{job.JobId, job.StepId, job.Uid, job.User}
+		ch <- prometheus.MustNewConstMetric(cc.jobCpuSeconds, prometheus.CounterValue, job.CpuSeconds, labels...)
+		ch <- prometheus.MustNewConstMetric(cc.jobMemoryCurrent, prometheus.GaugeValue, job.MemoryCurrentBytes, labels...)
+		ch <- prometheus.MustNewConstMetric(cc.jobMemoryMax, prometheus.GaugeValue, job.MemoryMaxBytes, labels...)
+		ch <- prometheus.MustNewConstMetric(cc.jobPids, prometheus.GaugeValue, job.Pids, labels...)
+		ch <- prometheus.MustNewConstMetric(cc.jobIoReadBytes, prometheus.CounterValue, job.IoReadBytes, labels...)
+		ch <- prometheus.MustNewConstMetric(cc.jobIoWriteBytes, prometheus.CounterValue, job.IoWriteBytes, labels...)
+	}
+}
+
+// RegisterNodeAgentCollectors wires the node-agent mode's collectors into
+// reg. Unlike RegisterCollectors, this does not talk to the Slurm
+// controller at all - it only reads local cgroup state.
+func RegisterNodeAgentCollectors(reg prometheus.Registerer) error {
+	return reg.Register(NewCgroupsCollector())
+}
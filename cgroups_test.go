@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCgroupSingleValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    float64
+		wantErr bool
+	}{
+		{name: "plain value", content: "1048576\n", want: 1048576},
+		{name: "no trailing newline", content: "42", want: 42},
+		{name: "not a number", content: "max\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "value")
+			writeFile(t, path, tt.content)
+			got, err := readCgroupSingleValue(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := readCgroupSingleValue(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error reading missing file")
+	}
+}
+
+func TestReadCgroupKeyValue(t *testing.T) {
+	content := "usage_usec 123456\nuser_usec 100000\nsystem_usec 23456\n"
+	tests := []struct {
+		name    string
+		key     string
+		want    float64
+		wantErr bool
+	}{
+		{name: "first key", key: "usage_usec", want: 123456},
+		{name: "later key", key: "system_usec", want: 23456},
+		{name: "missing key", key: "nice_usec", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cpu.stat")
+			writeFile(t, path, content)
+			got, err := readCgroupKeyValue(path, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCgroupIoStat(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantRead  float64
+		wantWrite float64
+	}{
+		{
+			name:      "single device",
+			content:   "8:0 rbytes=1024 wbytes=2048 rios=4 wios=8\n",
+			wantRead:  1024,
+			wantWrite: 2048,
+		},
+		{
+			name: "multiple devices are summed",
+			content: "8:0 rbytes=1024 wbytes=2048 rios=4 wios=8\n" +
+				"8:16 rbytes=512 wbytes=0 rios=2 wios=0\n",
+			wantRead:  1536,
+			wantWrite: 2048,
+		},
+		{
+			name:      "empty file",
+			content:   "",
+			wantRead:  0,
+			wantWrite: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "io.stat")
+			writeFile(t, path, tt.content)
+			gotRead, gotWrite, err := readCgroupIoStat(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gotRead != tt.wantRead {
+				t.Errorf("readBytes = %v, want %v", gotRead, tt.wantRead)
+			}
+			if gotWrite != tt.wantWrite {
+				t.Errorf("writeBytes = %v, want %v", gotWrite, tt.wantWrite)
+			}
+		})
+	}
+}
+
+// writeFile writes content to path, failing the test on error.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
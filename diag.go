@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/NucciTheBoss/prometheus-slurm-exporter/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/slog"
+)
+
+// RpcStat captures the cumulative call count and time spent for a single
+// Slurm RPC message type, as reported by sdiag.
+type RpcStat struct {
+	Type      string  `json:"message_type"`
+	Count     float64 `json:"count"`
+	TotalTime float64 `json:"total_time"`
+}
+
+// DiagStatistics mirrors the "statistics" object of sdiag --json (and the
+// equivalent slurmrestd /diag response).
+type DiagStatistics struct {
+	ScheduleCycleTotal  float64   `json:"schedule_cycle_total"`
+	ScheduleCycleLast   float64   `json:"schedule_cycle_last"`
+	ScheduleQueueLength float64   `json:"schedule_queue_length"`
+	BfCycleTotal        float64   `json:"bf_cycle_counter"`
+	BfLastDepth         float64   `json:"bf_last_depth"`
+	ReqTime             float64   `json:"req_time"`
+	RpcStats            []RpcStat `json:"rpcs_by_message_type"`
+}
+
+type sdiagResponse struct {
+	Meta       map[string]interface{} `json:"meta"`
+	Errors     []string               `json:"errors"`
+	Statistics DiagStatistics         `json:"statistics"`
+}
+
+func parseDiagMetrics(jsonDiag []byte) (*DiagStatistics, error) {
+	sdiag := sdiagResponse{}
+	err := json.Unmarshal(jsonDiag, &sdiag)
+	if err != nil {
+		slog.Error("Unmarshaling diag metrics %q", err)
+		return nil, err
+	}
+	if len(sdiag.Errors) > 0 {
+		for _, e := range sdiag.Errors {
+			slog.Error("Api error response %q", e)
+		}
+		return nil, errors.New(sdiag.Errors[0])
+	}
+	return &sdiag.Statistics, nil
+}
+
+type DiagCollector struct {
+	// collector state
+	cache   *AtomicThrottledCache
+	fetcher SlurmFetcher
+	// scheduler stats
+	scheduleCyclesTotal *prometheus.Desc
+	scheduleCycleLast   *prometheus.Desc
+	scheduleQueueLength *prometheus.Desc
+	backfillCyclesTotal *prometheus.Desc
+	backfillLastDepth   *prometheus.Desc
+	controllerHeartbeat *prometheus.Desc
+	// rpc stats
+	rpcCallsTotal *prometheus.Desc
+	rpcTimeTotal  *prometheus.Desc
+	// exporter metrics
+	up     prometheus.Gauge
+	scrape *metrics.ScrapeMetrics
+}
+
+func NewDiagCollector() *DiagCollector {
+	diag := metrics.NewFactory("scheduler")
+	rpc := metrics.NewFactory("rpc")
+	return &DiagCollector{
+		cache:               NewAtomicThrottledCache(),
+		fetcher:             NewDiagFetcher(),
+		scheduleCyclesTotal: diag.NewDesc("cycles_total", "Total main scheduler cycles since last reset"),
+		scheduleCycleLast:   diag.NewDesc("cycle_last_seconds", "Time consumed by the last main scheduler cycle"),
+		scheduleQueueLength: diag.NewDesc("queue_length", "Length of the main scheduler queue"),
+		backfillCyclesTotal: metrics.NewFactory("backfill").NewDesc("cycles_total", "Total backfill scheduler cycles since last reset"),
+		backfillLastDepth:   metrics.NewFactory("backfill").NewDesc("last_depth", "Number of jobs processed in the last backfill cycle"),
+		controllerHeartbeat: metrics.NewFactory("controller").NewDesc("heartbeat_timestamp", "Unix timestamp of the last successful sdiag response"),
+		rpcCallsTotal:       rpc.NewDesc("calls_total", "Total RPC calls handled by the controller", "type"),
+		rpcTimeTotal:        rpc.NewDesc("time_seconds_total", "Total time spent handling RPC calls", "type"),
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "slurm_up",
+			Help: "Whether the last scrape of the Slurm controller succeeded",
+		}),
+		scrape: metrics.NewScrapeMetrics("diag"),
+	}
+}
+
+func (dc *DiagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dc.scheduleCyclesTotal
+	ch <- dc.scheduleCycleLast
+	ch <- dc.scheduleQueueLength
+	ch <- dc.backfillCyclesTotal
+	ch <- dc.backfillLastDepth
+	ch <- dc.controllerHeartbeat
+	ch <- dc.rpcCallsTotal
+	ch <- dc.rpcTimeTotal
+	ch <- dc.up.Desc()
+	dc.scrape.Describe(ch)
+}
+
+func (dc *DiagCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	defer func() {
+		ch <- dc.up
+		dc.scrape.ObserveDuration(start)
+		dc.scrape.Collect(ch)
+	}()
+	sdiag, err := dc.cache.Fetch(dc.fetcher)
+	if err != nil {
+		slog.Error("Failed to fetch from cli: " + err.Error())
+		dc.scrape.IncErrors()
+		dc.up.Set(0)
+		return
+	}
+	stats, err := parseDiagMetrics(sdiag)
+	if err != nil {
+		dc.scrape.IncErrors()
+		slog.Error("Failed to parse diag metrics: " + err.Error())
+		dc.up.Set(0)
+		return
+	}
+	dc.up.Set(1)
+	ch <- prometheus.MustNewConstMetric(dc.scheduleCyclesTotal, prometheus.CounterValue, stats.ScheduleCycleTotal)
+	// sdiag reports cycle and rpc times in microseconds
+	ch <- prometheus.MustNewConstMetric(dc.scheduleCycleLast, prometheus.GaugeValue, stats.ScheduleCycleLast/1e6)
+	ch <- prometheus.MustNewConstMetric(dc.scheduleQueueLength, prometheus.GaugeValue, stats.ScheduleQueueLength)
+	ch <- prometheus.MustNewConstMetric(dc.backfillCyclesTotal, prometheus.CounterValue, stats.BfCycleTotal)
+	ch <- prometheus.MustNewConstMetric(dc.backfillLastDepth, prometheus.GaugeValue, stats.BfLastDepth)
+	ch <- prometheus.MustNewConstMetric(dc.controllerHeartbeat, prometheus.GaugeValue, stats.ReqTime)
+	for _, rpc := range stats.RpcStats {
+		ch <- prometheus.MustNewConstMetric(dc.rpcCallsTotal, prometheus.CounterValue, rpc.Count, rpc.Type)
+		ch <- prometheus.MustNewConstMetric(dc.rpcTimeTotal, prometheus.CounterValue, rpc.TotalTime/1e6, rpc.Type)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+var (
+	fetcherBackendFlag = flag.String("fetcher-backend", envOrDefault("SLURM_EXPORTER_FETCHER", "cli"),
+		"Backend used to fetch Slurm data for the node/job/diag collectors: cli|rest")
+	restURLFlag = flag.String("rest-url", os.Getenv("SLURM_EXPORTER_REST_URL"),
+		"Base URL of the slurmrestd instance to query when --fetcher-backend=rest")
+	restAPIVersionFlag = flag.String("rest-api-version", envOrDefault("SLURM_EXPORTER_REST_API_VERSION", "v0.0.39"),
+		"slurmrestd API version path segment, e.g. v0.0.39")
+	restTimeoutFlag = flag.Duration("rest-timeout", durationEnvOrDefault("SLURM_EXPORTER_REST_TIMEOUT", 10*time.Second),
+		"Timeout for requests to slurmrestd")
+	restInsecureFlag = flag.Bool("rest-insecure", os.Getenv("SLURM_EXPORTER_REST_INSECURE") == "true",
+		"Skip TLS certificate verification when querying slurmrestd")
+)
+
+// envOrDefault returns the value of the env var key, or def if it's unset.
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// durationEnvOrDefault parses the env var key as a whole number of seconds,
+// falling back to def if it's unset or invalid.
+func durationEnvOrDefault(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	secs, err := strconv.Atoi(raw)
+	if err != nil {
+		slog.Error("Invalid %s %q: %s", key, raw, err)
+		return def
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// SlurmFetcher abstracts how a collector obtains raw JSON from Slurm,
+// whether that's shelling out to a CLI tool (sinfo, squeue, ...) or
+// querying slurmrestd directly.
+type SlurmFetcher interface {
+	Fetch() ([]byte, error)
+}
+
+// cliFetcher runs a local Slurm CLI command and returns its stdout.
+type cliFetcher struct {
+	cmd  string
+	args []string
+}
+
+// NewCliFetcher returns a SlurmFetcher that shells out to cmd with args,
+// e.g. NewCliFetcher("sinfo", "--json").
+func NewCliFetcher(cmd string, args ...string) SlurmFetcher {
+	return &cliFetcher{cmd: cmd, args: args}
+}
+
+func (f *cliFetcher) Fetch() ([]byte, error) {
+	out, err := exec.Command(f.cmd, f.args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("running %s %s: %w", f.cmd, strings.Join(f.args, " "), err)
+	}
+	return out, nil
+}
+
+// TokenSource supplies the JWT used to authenticate against slurmrestd.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// envTokenSource reads the token from the SLURM_JWT environment variable,
+// matching how the Slurm CLI tools pick it up.
+type envTokenSource struct{}
+
+func NewEnvTokenSource() TokenSource {
+	return envTokenSource{}
+}
+
+func (envTokenSource) Token() (string, error) {
+	token := os.Getenv("SLURM_JWT")
+	if token == "" {
+		return "", fmt.Errorf("SLURM_JWT is not set")
+	}
+	return token, nil
+}
+
+// scontrolTokenSource mints a fresh token by invoking `scontrol token`,
+// which is the approach operators use when SLURM_JWT isn't pre-populated.
+type scontrolTokenSource struct{}
+
+func NewScontrolTokenSource() TokenSource {
+	return scontrolTokenSource{}
+}
+
+func (scontrolTokenSource) Token() (string, error) {
+	out, err := exec.Command("scontrol", "token").Output()
+	if err != nil {
+		return "", fmt.Errorf("running scontrol token: %w", err)
+	}
+	// scontrol prints "SLURM_JWT=<token>"
+	_, token, ok := strings.Cut(strings.TrimSpace(string(out)), "=")
+	if !ok {
+		return "", fmt.Errorf("unexpected scontrol token output: %q", out)
+	}
+	return token, nil
+}
+
+// restFetcher queries a slurmrestd endpoint directly over HTTP(S).
+type restFetcher struct {
+	url         string
+	tokenSource TokenSource
+	client      *http.Client
+}
+
+// NewRestFetcher returns a SlurmFetcher that queries url on slurmrestd,
+// authenticating with the JWT returned by tokenSource.
+func NewRestFetcher(url string, tokenSource TokenSource, timeout time.Duration, tlsConfig *tls.Config) SlurmFetcher {
+	return &restFetcher{
+		url:         url,
+		tokenSource: tokenSource,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
+func (f *restFetcher) Fetch() ([]byte, error) {
+	token, err := f.tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("obtaining slurmrestd token: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-SLURM-USER-TOKEN", token)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying slurmrestd: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading slurmrestd response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("slurmrestd returned %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
+
+// FetcherBackend selects which SlurmFetcher implementation the exporter
+// binary wires up for a given data source.
+type FetcherBackend string
+
+const (
+	FetcherBackendCli  FetcherBackend = "cli"
+	FetcherBackendRest FetcherBackend = "rest"
+)
+
+// fetcherBackend resolves the backend from the --fetcher-backend flag
+// (falling back to the CLI backend).
+func fetcherBackend() FetcherBackend {
+	switch FetcherBackend(strings.ToLower(*fetcherBackendFlag)) {
+	case FetcherBackendRest:
+		return FetcherBackendRest
+	default:
+		return FetcherBackendCli
+	}
+}
+
+// NewNodeFetcher returns the SlurmFetcher NodesCollector should use, picked
+// by the configured backend (--fetcher-backend=cli|rest).
+func NewNodeFetcher() SlurmFetcher {
+	return newFetcher("sinfo", []string{"--json"}, "nodes")
+}
+
+// NewJobFetcher returns the SlurmFetcher JobsCollector should use, picked
+// by the configured backend (--fetcher-backend=cli|rest).
+func NewJobFetcher() SlurmFetcher {
+	return newFetcher("squeue", []string{"--json"}, "jobs")
+}
+
+// NewDiagFetcher returns the SlurmFetcher DiagCollector should use, picked
+// by the configured backend (--fetcher-backend=cli|rest).
+func NewDiagFetcher() SlurmFetcher {
+	return newFetcher("sdiag", []string{"--json"}, "diag")
+}
+
+func newFetcher(cliCmd string, cliArgs []string, restResource string) SlurmFetcher {
+	if fetcherBackend() != FetcherBackendRest {
+		return NewCliFetcher(cliCmd, cliArgs...)
+	}
+	baseURL := strings.TrimRight(*restURLFlag, "/")
+	var tlsConfig *tls.Config
+	if *restInsecureFlag {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	tokenSource := TokenSource(NewEnvTokenSource())
+	if _, err := tokenSource.Token(); err != nil {
+		tokenSource = NewScontrolTokenSource()
+	}
+	url := fmt.Sprintf("%s/slurm/%s/%s", baseURL, *restAPIVersionFlag, restResource)
+	return NewRestFetcher(url, tokenSource, *restTimeoutFlag, tlsConfig)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/NucciTheBoss/prometheus-slurm-exporter/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/slog"
+)
+
+type JobMetrics struct {
+	JobId      float64 `json:"job_id"`
+	Partition  string  `json:"partition"`
+	Account    string  `json:"account"`
+	UserName   string  `json:"user_name"`
+	Qos        string  `json:"qos"`
+	JobState   string  `json:"job_state"`
+	SubmitTime float64 `json:"submit_time"`
+	StartTime  float64 `json:"start_time"`
+}
+
+type squeueResponse struct {
+	Meta   map[string]interface{} `json:"meta"`
+	Errors []string               `json:"errors"`
+	Jobs   []JobMetrics           `json:"jobs"`
+}
+
+func parseJobMetrics(jsonJobList []byte) ([]JobMetrics, error) {
+	squeue := squeueResponse{}
+	err := json.Unmarshal(jsonJobList, &squeue)
+	if err != nil {
+		slog.Error("Unmarshaling job metrics %q", err)
+		return nil, err
+	}
+	if len(squeue.Errors) > 0 {
+		for _, e := range squeue.Errors {
+			slog.Error("Api error response %q", e)
+		}
+		return nil, errors.New(squeue.Errors[0])
+	}
+	return squeue.Jobs, nil
+}
+
+// JobStateKey identifies a unique combination of labels that per-state job
+// counts are broken out by.
+type JobStateKey struct {
+	State     string
+	Partition string
+	Account   string
+	User      string
+	Qos       string
+}
+
+func fetchJobMetricsByState(jobs []JobMetrics) map[JobStateKey]float64 {
+	counts := make(map[JobStateKey]float64)
+	for _, job := range jobs {
+		key := JobStateKey{
+			State:     job.JobState,
+			Partition: job.Partition,
+			Account:   job.Account,
+			User:      job.UserName,
+			Qos:       job.Qos,
+		}
+		counts[key]++
+	}
+	return counts
+}
+
+// jobWaitTimeBuckets are the upper bounds (in seconds) used to bucket job
+// wait times for the slurm_job_wait_seconds histogram.
+var jobWaitTimeBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 21600, 86400}
+
+type JobWaitMetrics struct {
+	Buckets map[float64]uint64
+	Sum     float64
+	Count   uint64
+}
+
+// fetchJobMetricsByWaitTime computes a cumulative histogram of job wait
+// times (start_time - submit_time) for jobs that have already started.
+func fetchJobMetricsByWaitTime(jobs []JobMetrics) *JobWaitMetrics {
+	wait := &JobWaitMetrics{Buckets: make(map[float64]uint64)}
+	for _, job := range jobs {
+		if job.StartTime <= 0 || job.SubmitTime <= 0 {
+			continue
+		}
+		waitTime := job.StartTime - job.SubmitTime
+		if waitTime < 0 {
+			waitTime = 0
+		}
+		wait.Sum += waitTime
+		wait.Count++
+		for _, bucket := range jobWaitTimeBuckets {
+			if _, ok := wait.Buckets[bucket]; !ok {
+				wait.Buckets[bucket] = 0
+			}
+			if waitTime <= bucket {
+				wait.Buckets[bucket]++
+			}
+		}
+	}
+	return wait
+}
+
+type JobsCollector struct {
+	// collector state
+	cache   *AtomicThrottledCache
+	fetcher SlurmFetcher
+	// per-state job counts
+	jobsPerState *prometheus.Desc
+	// job wait time
+	jobWaitSeconds *prometheus.Desc
+	// exporter metrics
+	scrape *metrics.ScrapeMetrics
+}
+
+func NewJobsCollector() *JobsCollector {
+	job := metrics.NewFactory("job")
+	return &JobsCollector{
+		cache:          NewAtomicThrottledCache(),
+		fetcher:        NewJobFetcher(),
+		jobsPerState:   job.NewDesc("per_state", "Job count per state", "state", "partition", "account", "user", "qos"),
+		jobWaitSeconds: job.NewDesc("wait_seconds", "Job wait time between submission and start"),
+		scrape:         metrics.NewScrapeMetrics("job"),
+	}
+}
+
+func (jc *JobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jc.jobsPerState
+	ch <- jc.jobWaitSeconds
+	jc.scrape.Describe(ch)
+}
+
+func (jc *JobsCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	defer func() {
+		jc.scrape.ObserveDuration(start)
+		jc.scrape.Collect(ch)
+	}()
+	squeue, err := jc.cache.Fetch(jc.fetcher)
+	if err != nil {
+		slog.Error("Failed to fetch from cli: " + err.Error())
+		jc.scrape.IncErrors()
+		return
+	}
+	jobMetrics, err := parseJobMetrics(squeue)
+	if err != nil {
+		jc.scrape.IncErrors()
+		slog.Error("Failed to parse job metrics: " + err.Error())
+		return
+	}
+	// per-state set
+	stateMetrics := fetchJobMetricsByState(jobMetrics)
+	for key, count := range stateMetrics {
+		ch <- prometheus.MustNewConstMetric(jc.jobsPerState, prometheus.GaugeValue, count, key.State, key.Partition, key.Account, key.User, key.Qos)
+	}
+	// wait time histogram
+	waitMetrics := fetchJobMetricsByWaitTime(jobMetrics)
+	ch <- prometheus.MustNewConstHistogram(jc.jobWaitSeconds, waitMetrics.Count, waitMetrics.Sum, waitMetrics.Buckets)
+}
+
+// RegisterCollectors wires the node, job and diag collectors into reg,
+// sharing the same AtomicThrottledCache/SlurmFetcher plumbing.
+func RegisterCollectors(reg prometheus.Registerer) error {
+	if err := reg.Register(NewNodeCollecter()); err != nil {
+		return err
+	}
+	if err := reg.Register(NewJobsCollector()); err != nil {
+		return err
+	}
+	if err := reg.Register(NewDiagCollector()); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFetchJobMetricsByWaitTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobs    []JobMetrics
+		wantSum float64
+		wantCnt uint64
+		wantBkt map[float64]uint64
+	}{
+		{
+			name:    "no jobs",
+			jobs:    nil,
+			wantSum: 0,
+			wantCnt: 0,
+			wantBkt: map[float64]uint64{},
+		},
+		{
+			name: "pending job has no wait time yet",
+			jobs: []JobMetrics{
+				{SubmitTime: 1000, StartTime: 0},
+			},
+			wantSum: 0,
+			wantCnt: 0,
+			wantBkt: map[float64]uint64{},
+		},
+		{
+			name: "single started job falls in every bucket above its wait",
+			jobs: []JobMetrics{
+				{SubmitTime: 1000, StartTime: 1100},
+			},
+			wantSum: 100,
+			wantCnt: 1,
+			wantBkt: map[float64]uint64{60: 0, 300: 1, 900: 1, 1800: 1, 3600: 1, 7200: 1, 21600: 1, 86400: 1},
+		},
+		{
+			name: "wait time clamped to zero when start precedes submit",
+			jobs: []JobMetrics{
+				{SubmitTime: 1000, StartTime: 500},
+			},
+			wantSum: 0,
+			wantCnt: 1,
+			wantBkt: map[float64]uint64{60: 1, 300: 1, 900: 1, 1800: 1, 3600: 1, 7200: 1, 21600: 1, 86400: 1},
+		},
+		{
+			name: "multiple jobs accumulate across buckets",
+			jobs: []JobMetrics{
+				{SubmitTime: 1000, StartTime: 1030},   // 30s
+				{SubmitTime: 1000, StartTime: 2000},   // 1000s
+				{SubmitTime: 1000, StartTime: 100000}, // 99000s
+			},
+			wantSum: 30 + 1000 + 99000,
+			wantCnt: 3,
+			wantBkt: map[float64]uint64{60: 1, 300: 1, 900: 1, 1800: 2, 3600: 2, 7200: 2, 21600: 2, 86400: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fetchJobMetricsByWaitTime(tt.jobs)
+			if got.Sum != tt.wantSum {
+				t.Errorf("Sum = %v, want %v", got.Sum, tt.wantSum)
+			}
+			if got.Count != tt.wantCnt {
+				t.Errorf("Count = %v, want %v", got.Count, tt.wantCnt)
+			}
+			if !reflect.DeepEqual(got.Buckets, tt.wantBkt) {
+				t.Errorf("Buckets = %v, want %v", got.Buckets, tt.wantBkt)
+			}
+		})
+	}
+}
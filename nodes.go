@@ -3,11 +3,51 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"flag"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/NucciTheBoss/prometheus-slurm-exporter/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/exp/slog"
 )
 
+// NodeDetailLevel controls how much per-node cardinality NodesCollector
+// is willing to emit, beyond the partition/cluster rollups it always
+// exports.
+type NodeDetailLevel string
+
+const (
+	// NodeDetailSummary only exports partition and cluster rollups.
+	NodeDetailSummary NodeDetailLevel = "summary"
+	// NodeDetailPerNode additionally exports one set of basic gauges per
+	// node (cpus, alloc cpus, free mem, cpu load, state).
+	NodeDetailPerNode NodeDetailLevel = "per-node"
+	// NodeDetailPerNodeFull additionally breaks per-node GPU/GRES counts
+	// out by GPU type.
+	NodeDetailPerNodeFull NodeDetailLevel = "per-node-full"
+)
+
+var (
+	nodeDetailFlag = flag.String("node-detail", string(NodeDetailSummary),
+		"Per-node metric detail level: summary|per-node|per-node-full")
+	nodeDetailCardinalityCapFlag = flag.Int("node-detail-cardinality-cap", 2000,
+		"Maximum node count before per-node metrics are suppressed in favor of summary-only output")
+)
+
+func nodeDetailLevel() NodeDetailLevel {
+	switch NodeDetailLevel(*nodeDetailFlag) {
+	case NodeDetailPerNode:
+		return NodeDetailPerNode
+	case NodeDetailPerNodeFull:
+		return NodeDetailPerNodeFull
+	default:
+		return NodeDetailSummary
+	}
+}
+
 type NodeMetrics struct {
 	Hostname     string   `json:"hostname"`
 	Cpus         float64  `json:"cpus"`
@@ -21,6 +61,43 @@ type NodeMetrics struct {
 	Weight       float64  `json:"weight"`
 	CpuLoad      float64  `json:"cpu_load"`
 	Architecture string   `json:"architecture"`
+	Gres         string   `json:"gres"`
+	GresUsed     string   `json:"gres_used"`
+	Tres         string   `json:"tres"`
+}
+
+// gresEntryPattern matches a single comma-separated GRES/TRES entry, e.g.
+// "gpu:a100:4", "gpu:a100:2(IDX:0-1)" or the typeless "gpu:4".
+var gresEntryPattern = regexp.MustCompile(`^([a-zA-Z0-9_]+)(?::([a-zA-Z0-9_]+))?:(\d+)`)
+
+// gresListSeparator splits a GRES/TRES string on its comma delimiters.
+var gresListSeparator = regexp.MustCompile(`\s*,\s*`)
+
+// parseGresCounts parses a Slurm GRES/GRES_USED string such as
+// "gpu:a100:4,gpu:v100:2" into per-GPU-type counts. Entries that are not
+// "gpu" gres (e.g. "mps", "license") are ignored. Entries without an
+// explicit type are reported under the gres name itself.
+func parseGresCounts(gres string) map[string]float64 {
+	counts := make(map[string]float64)
+	if gres == "" || gres == "(null)" {
+		return counts
+	}
+	for _, entry := range gresListSeparator.Split(gres, -1) {
+		m := gresEntryPattern.FindStringSubmatch(entry)
+		if m == nil || m[1] != "gpu" {
+			continue
+		}
+		gpuType := m[2]
+		if gpuType == "" {
+			gpuType = "gpu"
+		}
+		count, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			continue
+		}
+		counts[gpuType] += count
+	}
+	return counts
 }
 
 type sinfoResponse struct {
@@ -45,6 +122,13 @@ func parseNodeMetrics(jsonNodeList []byte) ([]NodeMetrics, error) {
 	return squeue.Nodes, nil
 }
 
+// GpuMetrics holds the total and allocated GPU counts for a single GPU
+// type (e.g. "a100") within a partition. Idle is derived as Total - Alloc.
+type GpuMetrics struct {
+	Total float64
+	Alloc float64
+}
+
 type PartitionMetrics struct {
 	Cpus        float64
 	RealMemory  float64
@@ -54,6 +138,7 @@ type PartitionMetrics struct {
 	CpuLoad     float64
 	IdleCpus    float64
 	Weight      float64
+	Gpus        map[string]*GpuMetrics
 }
 
 func fetchNodePartitionMetrics(nodes []NodeMetrics) map[string]*PartitionMetrics {
@@ -63,6 +148,7 @@ func fetchNodePartitionMetrics(nodes []NodeMetrics) map[string]*PartitionMetrics
 			partition, ok := partitions[p]
 			if !ok {
 				partition = new(PartitionMetrics)
+				partition.Gpus = make(map[string]*GpuMetrics)
 				partitions[p] = partition
 			}
 			partition.Cpus += node.Cpus
@@ -73,6 +159,22 @@ func fetchNodePartitionMetrics(nodes []NodeMetrics) map[string]*PartitionMetrics
 			partition.IdleCpus += node.IdleCpus
 			partition.Weight += node.Weight
 			partition.CpuLoad += node.CpuLoad
+			for gpuType, total := range parseGresCounts(node.Gres) {
+				gpu, ok := partition.Gpus[gpuType]
+				if !ok {
+					gpu = new(GpuMetrics)
+					partition.Gpus[gpuType] = gpu
+				}
+				gpu.Total += total
+			}
+			for gpuType, alloc := range parseGresCounts(node.GresUsed) {
+				gpu, ok := partition.Gpus[gpuType]
+				if !ok {
+					gpu = new(GpuMetrics)
+					partition.Gpus[gpuType] = gpu
+				}
+				gpu.Alloc += alloc
+			}
 		}
 	}
 	return partitions
@@ -127,6 +229,10 @@ type NodesCollector struct {
 	partitionIdleCpus    *prometheus.Desc
 	partitionWeight      *prometheus.Desc
 	partitionCpuLoad     *prometheus.Desc
+	// partition gpu/gres stats
+	partitionGpusTotal *prometheus.Desc
+	partitionGpusAlloc *prometheus.Desc
+	partitionGpusIdle  *prometheus.Desc
 	// cpu summary stats
 	cpusPerState  *prometheus.Desc
 	totalCpus     *prometheus.Desc
@@ -136,37 +242,69 @@ type NodesCollector struct {
 	totalRealMemory  *prometheus.Desc
 	totalFreeMemory  *prometheus.Desc
 	totalAllocMemory *prometheus.Desc
+	// per-node detail metrics (opt-in via --node-detail)
+	nodeCpus       *prometheus.Desc
+	nodeAllocCpus  *prometheus.Desc
+	nodeFreeMem    *prometheus.Desc
+	nodeCpuLoad    *prometheus.Desc
+	nodeState      *prometheus.Desc
+	nodeGpusTotal  *prometheus.Desc
+	nodeGpusAlloc  *prometheus.Desc
+	nodeGpusIdle   *prometheus.Desc
+	detailLevel    NodeDetailLevel
+	cardinalityCap int
+	overCapLogged  bool
 	// exporter metrics
-	nodeScrapeErrors prometheus.Counter
+	scrape *metrics.ScrapeMetrics
 }
 
 func NewNodeCollecter() *NodesCollector {
+	partition := metrics.NewFactory("partition")
+	node := metrics.NewFactory("node")
+	cpu := metrics.NewFactory("cpu")
+	mem := metrics.NewFactory("mem")
 	return &NodesCollector{
 		cache:   NewAtomicThrottledCache(),
-		fetcher: NewCliFetcher("sinfo", "--json"),
+		fetcher: NewNodeFetcher(),
 		// partition stats
-		partitionCpus:        prometheus.NewDesc("slurm_partition_total_cpus", "Total cpus per partition", []string{"partition"}, nil),
-		partitionRealMemory:  prometheus.NewDesc("slurm_partition_real_mem", "Real mem per partition", []string{"partition"}, nil),
-		partitionFreeMemory:  prometheus.NewDesc("slurm_partition_free_mem", "Free mem per partition", []string{"partition"}, nil),
-		partitionAllocMemory: prometheus.NewDesc("slurm_partition_alloc_mem", "Alloc mem per partition", []string{"partition"}, nil),
-		partitionAllocCpus:   prometheus.NewDesc("slurm_partition_alloc_cpus", "Alloc cpus per partition", []string{"partition"}, nil),
-		partitionIdleCpus:    prometheus.NewDesc("slurm_partition_idle_cpus", "Idle cpus per partition", []string{"partition"}, nil),
-		partitionWeight:      prometheus.NewDesc("slurm_partition_weight", "Total node weight per partition??", []string{"partition"}, nil),
-		partitionCpuLoad:     prometheus.NewDesc("slurm_partition_cpu_load", "Total cpu load per partition", []string{"partition"}, nil),
+		partitionCpus:        partition.NewDesc("total_cpus", "Total cpus per partition", "partition"),
+		partitionRealMemory:  partition.NewDesc("real_mem", "Real mem per partition", "partition"),
+		partitionFreeMemory:  partition.NewDesc("free_mem", "Free mem per partition", "partition"),
+		partitionAllocMemory: partition.NewDesc("alloc_mem", "Alloc mem per partition", "partition"),
+		partitionAllocCpus:   partition.NewDesc("alloc_cpus", "Alloc cpus per partition", "partition"),
+		partitionIdleCpus:    partition.NewDesc("idle_cpus", "Idle cpus per partition", "partition"),
+		partitionWeight:      partition.NewDesc("weight", "Total node weight per partition??", "partition"),
+		partitionCpuLoad:     partition.NewDesc("cpu_load", "Total cpu load per partition", "partition"),
+		// partition gpu/gres stats
+		partitionGpusTotal: partition.NewDesc("gpus_total", "Total gpus per partition", "partition", "gpu_type"),
+		partitionGpusAlloc: partition.NewDesc("gpus_alloc", "Allocated gpus per partition", "partition", "gpu_type"),
+		partitionGpusIdle:  partition.NewDesc("gpus_idle", "Idle gpus per partition", "partition", "gpu_type"),
 		// node cpu summary stats
-		totalCpus:     prometheus.NewDesc("slurm_cpus_total", "Total cpus", nil, nil),
-		totalIdleCpus: prometheus.NewDesc("slurm_cpus_idle", "Total idle cpus", nil, nil),
-		totalCpuLoad:  prometheus.NewDesc("slurm_cpu_load", "Total cpu load", nil, nil),
-		cpusPerState:  prometheus.NewDesc("slurm_cpus_per_state", "Cpus per state i.e alloc, mixed, draining, etc.", []string{"state"}, nil),
+		// totalCpus/totalIdleCpus/cpusPerState keep their pre-existing
+		// slurm_cpus_* names (not slurm_cpu_*) to avoid breaking existing
+		// scrape configs and dashboards.
+		totalCpus:     metrics.NewNamespacedDesc("cpus_total", "Total cpus"),
+		totalIdleCpus: metrics.NewNamespacedDesc("cpus_idle", "Total idle cpus"),
+		totalCpuLoad:  cpu.NewDesc("load", "Total cpu load"),
+		cpusPerState:  metrics.NewNamespacedDesc("cpus_per_state", "Cpus per state i.e alloc, mixed, draining, etc.", "state"),
 		// node memory summary stats
-		totalRealMemory:  prometheus.NewDesc("slurm_mem_real", "Total real mem", nil, nil),
-		totalFreeMemory:  prometheus.NewDesc("slurm_mem_free", "Total free mem", nil, nil),
-		totalAllocMemory: prometheus.NewDesc("slurm_mem_alloc", "Total alloc mem", nil, nil),
+		totalRealMemory:  mem.NewDesc("real", "Total real mem"),
+		totalFreeMemory:  mem.NewDesc("free", "Total free mem"),
+		totalAllocMemory: mem.NewDesc("alloc", "Total alloc mem"),
+		// per-node detail stats
+		nodeCpus:      node.NewDesc("cpus", "Cpus on this node", "hostname", "architecture", "partitions"),
+		nodeAllocCpus: node.NewDesc("alloc_cpus", "Allocated cpus on this node", "hostname", "architecture", "partitions"),
+		nodeFreeMem:   node.NewDesc("free_mem", "Free mem on this node", "hostname", "architecture", "partitions"),
+		nodeCpuLoad:   node.NewDesc("cpu_load", "Cpu load on this node", "hostname", "architecture", "partitions"),
+		nodeState:     node.NewDesc("state", "Node state, one timeseries per state value", "hostname", "architecture", "partitions", "state"),
+		nodeGpusTotal: node.NewDesc("gpus_total", "Total gpus on this node", "hostname", "gpu_type"),
+		nodeGpusAlloc: node.NewDesc("gpus_alloc", "Allocated gpus on this node", "hostname", "gpu_type"),
+		nodeGpusIdle:  node.NewDesc("gpus_idle", "Idle gpus on this node", "hostname", "gpu_type"),
+		// per-node detail config
+		detailLevel:    nodeDetailLevel(),
+		cardinalityCap: *nodeDetailCardinalityCapFlag,
 		// exporter stats
-		nodeScrapeErrors: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "slurm_node_scrape_error",
-			Help: "slurm node info scrape errors",
-		}),
+		scrape: metrics.NewScrapeMetrics("node"),
 	}
 }
 
@@ -179,28 +317,41 @@ func (nc *NodesCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- nc.partitionIdleCpus
 	ch <- nc.partitionWeight
 	ch <- nc.partitionCpuLoad
+	ch <- nc.partitionGpusTotal
+	ch <- nc.partitionGpusAlloc
+	ch <- nc.partitionGpusIdle
 	ch <- nc.totalCpus
 	ch <- nc.totalIdleCpus
 	ch <- nc.cpusPerState
 	ch <- nc.totalRealMemory
 	ch <- nc.totalFreeMemory
 	ch <- nc.totalAllocMemory
-	ch <- nc.nodeScrapeErrors.Desc()
+	ch <- nc.nodeCpus
+	ch <- nc.nodeAllocCpus
+	ch <- nc.nodeFreeMem
+	ch <- nc.nodeCpuLoad
+	ch <- nc.nodeState
+	ch <- nc.nodeGpusTotal
+	ch <- nc.nodeGpusAlloc
+	ch <- nc.nodeGpusIdle
+	nc.scrape.Describe(ch)
 }
 
 func (nc *NodesCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
 	defer func() {
-		ch <- nc.nodeScrapeErrors
+		nc.scrape.ObserveDuration(start)
+		nc.scrape.Collect(ch)
 	}()
-	sinfo, err := nc.fetcher.Fetch()
+	sinfo, err := nc.cache.Fetch(nc.fetcher)
 	if err != nil {
 		slog.Error("Failed to fetch from cli: " + err.Error())
-		nc.nodeScrapeErrors.Inc()
+		nc.scrape.IncErrors()
 		return
 	}
 	nodeMetrics, err := parseNodeMetrics(sinfo)
 	if err != nil {
-		nc.nodeScrapeErrors.Inc()
+		nc.scrape.IncErrors()
 		slog.Error("Failed to parse node metrics: " + err.Error())
 		return
 	}
@@ -231,6 +382,17 @@ func (nc *NodesCollector) Collect(ch chan<- prometheus.Metric) {
 		if metric.CpuLoad > 0 {
 			ch <- prometheus.MustNewConstMetric(nc.partitionCpuLoad, prometheus.GaugeValue, metric.CpuLoad, partition)
 		}
+		for gpuType, gpu := range metric.Gpus {
+			if gpu.Total > 0 {
+				ch <- prometheus.MustNewConstMetric(nc.partitionGpusTotal, prometheus.GaugeValue, gpu.Total, partition, gpuType)
+			}
+			if gpu.Alloc > 0 {
+				ch <- prometheus.MustNewConstMetric(nc.partitionGpusAlloc, prometheus.GaugeValue, gpu.Alloc, partition, gpuType)
+			}
+			if idle := gpu.Total - gpu.Alloc; idle > 0 {
+				ch <- prometheus.MustNewConstMetric(nc.partitionGpusIdle, prometheus.GaugeValue, idle, partition, gpuType)
+			}
+		}
 	}
 	// node cpu summary set
 	nodeCpuMetrics := fetchNodeTotalCpuMetrics(nodeMetrics)
@@ -245,4 +407,50 @@ func (nc *NodesCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(nc.totalRealMemory, prometheus.GaugeValue, memMetrics.RealMemory)
 	ch <- prometheus.MustNewConstMetric(nc.totalFreeMemory, prometheus.GaugeValue, memMetrics.FreeMemory)
 	ch <- prometheus.MustNewConstMetric(nc.totalAllocMemory, prometheus.GaugeValue, memMetrics.AllocMemory)
-}
\ No newline at end of file
+	// per-node detail set (opt-in via --node-detail)
+	nc.collectNodeDetail(ch, nodeMetrics)
+}
+
+// collectNodeDetail emits per-node gauges when nc.detailLevel requests it,
+// guarding against runaway cardinality on large clusters.
+func (nc *NodesCollector) collectNodeDetail(ch chan<- prometheus.Metric, nodes []NodeMetrics) {
+	if nc.detailLevel == NodeDetailSummary {
+		return
+	}
+	if len(nodes) > nc.cardinalityCap {
+		if !nc.overCapLogged {
+			slog.Warn("Node count exceeds --node-detail-cardinality-cap, suppressing per-node metrics",
+				"nodes", len(nodes), "cap", nc.cardinalityCap)
+			nc.overCapLogged = true
+		}
+		return
+	}
+	nc.overCapLogged = false
+	for _, node := range nodes {
+		partitions := strings.Join(node.Partitions, ",")
+		ch <- prometheus.MustNewConstMetric(nc.nodeCpus, prometheus.GaugeValue, node.Cpus, node.Hostname, node.Architecture, partitions)
+		ch <- prometheus.MustNewConstMetric(nc.nodeAllocCpus, prometheus.GaugeValue, node.AllocCpus, node.Hostname, node.Architecture, partitions)
+		ch <- prometheus.MustNewConstMetric(nc.nodeFreeMem, prometheus.GaugeValue, node.FreeMemory, node.Hostname, node.Architecture, partitions)
+		ch <- prometheus.MustNewConstMetric(nc.nodeCpuLoad, prometheus.GaugeValue, node.CpuLoad, node.Hostname, node.Architecture, partitions)
+		ch <- prometheus.MustNewConstMetric(nc.nodeState, prometheus.GaugeValue, 1, node.Hostname, node.Architecture, partitions, node.State)
+
+		if nc.detailLevel != NodeDetailPerNodeFull {
+			continue
+		}
+		totals := parseGresCounts(node.Gres)
+		allocs := parseGresCounts(node.GresUsed)
+		for gpuType, total := range totals {
+			if total > 0 {
+				ch <- prometheus.MustNewConstMetric(nc.nodeGpusTotal, prometheus.GaugeValue, total, node.Hostname, gpuType)
+			}
+		}
+		for gpuType, alloc := range allocs {
+			if alloc > 0 {
+				ch <- prometheus.MustNewConstMetric(nc.nodeGpusAlloc, prometheus.GaugeValue, alloc, node.Hostname, gpuType)
+			}
+			if idle := totals[gpuType] - alloc; idle > 0 {
+				ch <- prometheus.MustNewConstMetric(nc.nodeGpusIdle, prometheus.GaugeValue, idle, node.Hostname, gpuType)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGresCounts(t *testing.T) {
+	tests := []struct {
+		name string
+		gres string
+		want map[string]float64
+	}{
+		{
+			name: "empty",
+			gres: "",
+			want: map[string]float64{},
+		},
+		{
+			name: "null placeholder",
+			gres: "(null)",
+			want: map[string]float64{},
+		},
+		{
+			name: "single typed gpu",
+			gres: "gpu:a100:4",
+			want: map[string]float64{"a100": 4},
+		},
+		{
+			name: "multiple typed gpus",
+			gres: "gpu:a100:4,gpu:v100:2",
+			want: map[string]float64{"a100": 4, "v100": 2},
+		},
+		{
+			name: "typed gpu with index suffix",
+			gres: "gpu:a100:2(IDX:0-1)",
+			want: map[string]float64{"a100": 2},
+		},
+		{
+			name: "typeless gpu",
+			gres: "gpu:4",
+			want: map[string]float64{"gpu": 4},
+		},
+		{
+			name: "non-gpu gres ignored",
+			gres: "mps:100,license:matlab:2",
+			want: map[string]float64{},
+		},
+		{
+			name: "mixed gpu and non-gpu gres",
+			gres: "gpu:a100:4,mps:100",
+			want: map[string]float64{"a100": 4},
+		},
+		{
+			name: "same type repeated is summed",
+			gres: "gpu:a100:2,gpu:a100:2",
+			want: map[string]float64{"a100": 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseGresCounts(tt.gres)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGresCounts(%q) = %v, want %v", tt.gres, got, tt.want)
+			}
+		})
+	}
+}